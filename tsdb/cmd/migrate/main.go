@@ -0,0 +1,94 @@
+// Command migrate bulk-loads an existing one-JSON-file-per-chain tsdb
+// tree into a kvStorage database, so a running instance can be switched
+// from the default JSON backend to the embedded KV backend without
+// losing history.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Harkishen-Singh/bench-routes/tsdb"
+)
+
+// migrateBatchSize bounds how many blocks go into a single
+// kvStorage.Append (and therefore a single Badger transaction) so that a
+// chain with years of accumulated history doesn't overflow Badger's
+// per-transaction size limit.
+const migrateBatchSize = 1000
+
+func main() {
+	srcDir := flag.String("src", "", "directory containing existing *.json chain files")
+	dstDir := flag.String("dst", "", "directory for the new kv storage database")
+	flag.Parse()
+
+	if *srcDir == "" || *dstDir == "" {
+		log.Fatal("both -src and -dst are required")
+	}
+
+	dst, err := tsdb.NewKVStorage(*dstDir)
+	if err != nil {
+		log.Fatalf("opening kv storage at %s: %v", *dstDir, err)
+	}
+	defer dst.Close()
+
+	src := tsdb.NewJSONStorage()
+
+	migrated := 0
+	walkErr := filepath.Walk(*srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, tsdb.FileExtension) {
+			return nil
+		}
+
+		srcHandle, err := src.Open(path)
+		if err != nil {
+			return err
+		}
+		blocks, err := src.Load(srcHandle)
+		if err != nil {
+			return err
+		}
+		if len(blocks) == 0 {
+			return nil
+		}
+
+		name := chainName(*srcDir, path)
+		dstHandle, err := dst.Open(name)
+		if err != nil {
+			return err
+		}
+		total := len(blocks)
+		for len(blocks) > 0 {
+			n := migrateBatchSize
+			if n > len(blocks) {
+				n = len(blocks)
+			}
+			if err := dst.Append(dstHandle, blocks[:n]); err != nil {
+				return err
+			}
+			blocks = blocks[n:]
+		}
+
+		migrated++
+		log.Printf("migrated %d blocks for chain %s", total, name)
+		return nil
+	})
+	if walkErr != nil {
+		log.Fatalf("migration failed: %v", walkErr)
+	}
+	log.Printf("migration complete: %d chains migrated", migrated)
+}
+
+// chainName derives the chain name kvStorage should key blocks under
+// from a JSON chain file's path relative to srcDir.
+func chainName(srcDir, path string) string {
+	rel := strings.TrimPrefix(path, srcDir)
+	rel = strings.TrimPrefix(rel, string(os.PathSeparator))
+	return strings.TrimSuffix(rel, tsdb.FileExtension)
+}
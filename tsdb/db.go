@@ -1,6 +1,7 @@
 package tsdb
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/common/log"
@@ -39,13 +41,14 @@ func GetNewBlock(blockType, value string) *Block {
 	}
 }
 
-// Encode decodes the structure and marshals into a string
-func (b Block) Encode() string {
+// Encode marshals the block into its string form, or an error if it
+// cannot be marshalled.
+func (b Block) Encode() (string, error) {
 	bbyte, err := json.Marshal(b)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	return string(bbyte)
+	return string(bbyte), nil
 }
 
 // GetType returns the type of the block
@@ -77,14 +80,38 @@ func (b Block) GetTimeStamp() string {
 
 // Chain contains Blocks arranged as a chain
 type Chain struct {
-	Path               string
-	Name               string
-	Route              string
-	Chain              []Block
-	LengthElements     int
+	Path           string
+	Name           string
+	Route          string
+	Chain          []Block
+	LengthElements int
+	// Format selects how this chain is persisted. Zero value is
+	// FormatJSON, matching the original on-disk format.
+	Format             ChainFormat
 	containsNewBlocks  bool
 	inActiveIterations uint32
-	mux                sync.Mutex
+	// bytesPending is the encoded byte size of the blocks appended since
+	// the last commit. Updated atomically so it can be read by
+	// ChainSet's space-based flusher without taking mux.
+	bytesPending int64
+	mux          sync.Mutex
+
+	// storage is the backend this chain persists through. Set via
+	// WithStorage; defaults to defaultStorage (one JSON file per chain).
+	storage Storage
+	// handle is storage's opaque reference to this chain, opened lazily
+	// by storageHandle on first use.
+	handle Handle
+
+	// owner is the ChainSet this chain was registered with, if any, so
+	// Append/commit can report byte accounting to its counter.
+	owner *ChainSet
+}
+
+// PendingBytes returns the encoded byte size of the blocks appended since
+// the chain's last commit.
+func (c *Chain) PendingBytes() int64 {
+	return atomic.LoadInt64(&c.bytesPending)
 }
 
 // ChainReadOnly is a read-only structure that contains
@@ -94,26 +121,79 @@ type Chain struct {
 type ChainReadOnly struct {
 	Path  string
 	Chain *[]Block
+
+	// storage is the backend Refresh reads through. Set via
+	// WithReadStorage; defaults to defaultStorage (one JSON file per
+	// chain).
+	storage Storage
+	// handle is storage's opaque reference to this chain, opened lazily
+	// by Refresh on first use.
+	handle Handle
+	// sorted caches whether the blocks loaded by the last Refresh are
+	// non-decreasing in NormalizedTime, so QueryRange/QueryRangeByType
+	// don't need to rescan the chain to decide it on every call.
+	sorted bool
+}
+
+// ChainReadOnlyOption customizes a ChainReadOnly at construction time.
+type ChainReadOnlyOption func(*ChainReadOnly)
+
+// WithReadStorage selects the Storage backend Refresh reads through.
+// Defaults to defaultStorage (one JSON file per chain) when not
+// supplied; must match the Storage the chain was written with.
+func WithReadStorage(s Storage) ChainReadOnlyOption {
+	return func(c *ChainReadOnly) {
+		c.storage = s
+	}
+}
+
+// ChainOption customizes a Chain at construction time.
+type ChainOption func(*Chain)
+
+// WithFormat selects the on-disk format used to persist the chain.
+// Defaults to FormatJSON when not supplied.
+func WithFormat(f ChainFormat) ChainOption {
+	return func(c *Chain) {
+		c.Format = f
+	}
+}
+
+// WithStorage selects the Storage backend used to persist the chain.
+// Defaults to defaultStorage (one JSON file per chain) when not supplied.
+func WithStorage(s Storage) ChainOption {
+	return func(c *Chain) {
+		c.storage = s
+	}
 }
 
 // NewChain returns a in-memory chain that implements the TSDB interface.
-func NewChain(path string) *Chain {
-	return &Chain{
+func NewChain(path string, opts ...ChainOption) *Chain {
+	c := &Chain{
 		Name:              filterChainPath(path),
 		Path:              path,
 		Chain:             []Block{},
 		LengthElements:    0,
 		containsNewBlocks: true,
+		storage:           defaultStorage,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // ReadOnly returns a in-memory chain that implements the TSDB interface.
-func ReadOnly(path string) *ChainReadOnly {
+func ReadOnly(path string, opts ...ChainReadOnlyOption) *ChainReadOnly {
 	var blockStream []Block
-	return &ChainReadOnly{
-		Path:  path,
-		Chain: &blockStream,
+	c := &ChainReadOnly{
+		Path:    path,
+		Chain:   &blockStream,
+		storage: defaultStorage,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func filterChainPath(name string) string {
@@ -135,20 +215,38 @@ type TSDB interface {
 	GetChain() *[]Block
 }
 
-// Init initialize Chain properties
-func (c *Chain) Init() *Chain {
-	if _, err := parse(c.Path); err != nil {
-		log.Infof("creating in-memory chain: %s\n", c.Name)
-		c.LengthElements = 0
+// Init initialize Chain properties. It returns an error rather than
+// panicking if the chain cannot be created on disk, so that callers can
+// decide whether a bad disk should take down the whole process.
+func (c *Chain) Init() (*Chain, error) {
+	if c.Format == FormatBinary {
+		// Binary-format chains persist through AppendWAL/Compact, not
+		// Storage, so there's no file to open here. Callers recovering an
+		// existing binary chain use LoadWithWAL instead of Init.
 		c.Chain = []Block{}
-		if err := saveToHDD(c.Path, []byte("[]")); err != nil {
-			panic(err)
-		}
-		return c
+		c.LengthElements = 0
+		return c, nil
+	}
+	if _, err := c.storageHandle(); err != nil {
+		return nil, err
 	}
 	c.Chain = []Block{}
 	c.LengthElements = len(c.Chain)
-	return c
+	return c, nil
+}
+
+// storageHandle lazily opens, and caches, this chain's handle into its
+// Storage backend.
+func (c *Chain) storageHandle() (Handle, error) {
+	if c.handle != nil {
+		return c.handle, nil
+	}
+	handle, err := c.storage.Open(c.Path)
+	if err != nil {
+		return nil, err
+	}
+	c.handle = handle
+	return handle, nil
 }
 
 // Append function appends the new block in the chain
@@ -159,6 +257,16 @@ func (c *Chain) Append(b Block) *Chain {
 	c.Chain = append(c.Chain, b)
 	c.LengthElements = len(c.Chain)
 	c.containsNewBlocks = true
+	if encoded, err := b.Encode(); err != nil {
+		log.Errorf("error encoding block for chain %s: %v\n", c.Name, err)
+	} else {
+		added := int64(len(encoded))
+		atomic.AddInt64(&c.bytesPending, added)
+		addBytesInMemory(added)
+		if c.owner != nil {
+			c.owner.addBytesInMemory(added)
+		}
+	}
 	if c.inActiveIterations != 0 {
 		c.inActiveIterations = 0
 	}
@@ -166,23 +274,40 @@ func (c *Chain) Append(b Block) *Chain {
 }
 
 // Commit saves or commits the existing chain in the secondary memory.
-// Returns the success status
-func (c *Chain) commit() *Chain {
+// The in-memory chain is snapshotted and cleared under the per-chain
+// lock, so the actual file I/O runs outside the lock.
+func (c *Chain) commit() error {
+	start := time.Now()
+
 	c.mux.Lock()
-	pathPointer, err := parse(c.Path)
-	if err != nil {
-		panic(err)
-	}
-	existingBlocks := loadFromStorage(pathPointer)
-	mergedBlocks := mergeBlocksSlice(existingBlocks, &c.Chain)
-	bytes := parseToJSON(*mergedBlocks)
-	if err := saveToHDD(c.Path, bytes); err != nil {
-		panic(err)
-	}
+	pendingBlocks := c.Chain
+	freed := atomic.SwapInt64(&c.bytesPending, 0)
 	c.Chain = []Block{}
 	c.containsNewBlocks = false
 	c.mux.Unlock()
-	return c
+
+	if c.Format == FormatBinary {
+		for _, b := range pendingBlocks {
+			if err := c.AppendWAL(b); err != nil {
+				return err
+			}
+		}
+	} else {
+		handle, err := c.storageHandle()
+		if err != nil {
+			return err
+		}
+		if err := c.storage.Append(handle, pendingBlocks); err != nil {
+			return err
+		}
+	}
+
+	addBytesInMemory(-freed)
+	if c.owner != nil {
+		c.owner.addBytesInMemory(-freed)
+	}
+	recordFlush(time.Since(start))
+	return nil
 }
 
 // VerifyChainPathExists verifies the existence of chain in the tsdb directory.
@@ -203,8 +328,29 @@ const (
 	// from the chain set in order to free up the memory from inactive
 	// chains.
 	// inActiveIterationsLimit = 5
+
+	// defaultParallelThreshold is the number of dirty chains in a single
+	// flush cycle above which commits are dispatched across a worker
+	// pool instead of being run serially.
+	defaultParallelThreshold = 100
+
+	// defaultFlushBytes is the default per-chain pending-byte threshold
+	// above which FlushAsSpace enqueues a chain for an out-of-cycle
+	// commit.
+	defaultFlushBytes = 1 << 20 // 1 MiB
+
+	// spaceFlushQueueSize bounds the number of chains that can be queued
+	// for a space-triggered flush before Append starts dropping enqueue
+	// attempts (the chain is offered to the queue again on its next Append,
+	// and Shutdown commits it, so nothing is lost, only delayed).
+	spaceFlushQueueSize = 1024
 )
 
+// ErrBackpressure is returned by ChainSet.TryAppend when the in-memory
+// footprint across all chains has reached MaxMemoryBytes and the
+// background flusher has not yet drained enough to admit the block.
+var ErrBackpressure = errors.New("tsdb: in-memory chain size exceeds MaxMemoryBytes")
+
 // ChainSet is a set of chain that manages the operations related to chains
 // on a macro level. These include flushing chains to the storage based on
 // regular time intervals or size (to be done). It can delete chains that are
@@ -214,32 +360,243 @@ type ChainSet struct {
 	FlushDuration time.Duration
 	flushType     int
 	Cmap          map[string]*Chain
-	cancel        chan interface{}
+	cancel        chan struct{}
+	shutdownOnce  sync.Once
+	wg            sync.WaitGroup
 	mux           sync.RWMutex
+
+	// flushConcurrency bounds the number of workers used to commit
+	// dirty chains in parallel once parallelThreshold is crossed.
+	flushConcurrency int
+	// parallelThreshold is the number of dirty chains in a flush cycle
+	// above which commits switch from serial to the worker pool.
+	parallelThreshold int
+
+	// FlushBytes is the per-chain pending-byte threshold above which a
+	// chain is enqueued for an out-of-cycle commit under FlushAsSpace.
+	FlushBytes int64
+	// MaxMemoryBytes is the ceiling on the total encoded bytes held
+	// in-memory, pending flush, across all chains. 0 means unlimited.
+	// Append blocks until the background flusher drains enough memory;
+	// TryAppend returns ErrBackpressure instead of blocking.
+	MaxMemoryBytes int64
+	flushCh        chan *Chain
+	spaceCond      *sync.Cond
+	// bytesInMemory is this ChainSet's own pending-flush byte total,
+	// scoped separately from the process-wide bytesInMemory metric so
+	// MaxMemoryBytes backpressure only ever reacts to this ChainSet's own
+	// chains.
+	bytesInMemory int64
+
+	// Storage is the backend used by NewChainFor to create and register
+	// new chains. Defaults to defaultStorage (one JSON file per chain).
+	Storage Storage
+}
+
+// addBytesInMemory adjusts this ChainSet's pending-flush byte total by
+// delta, which may be negative.
+func (cs *ChainSet) addBytesInMemory(delta int64) {
+	atomic.AddInt64(&cs.bytesInMemory, delta)
+}
+
+// loadBytesInMemory returns this ChainSet's current pending-flush byte
+// total.
+func (cs *ChainSet) loadBytesInMemory() int64 {
+	return atomic.LoadInt64(&cs.bytesInMemory)
+}
+
+// ChainSetOption customizes a ChainSet at construction time.
+type ChainSetOption func(*ChainSet)
+
+// WithFlushConcurrency sets the number of workers used to commit dirty
+// chains in parallel once the flush cycle crosses parallelThreshold.
+// n <= 0 is ignored.
+func WithFlushConcurrency(n int) ChainSetOption {
+	return func(cs *ChainSet) {
+		if n > 0 {
+			cs.flushConcurrency = n
+		}
+	}
+}
+
+// WithParallelThreshold sets the number of dirty chains in a single flush
+// cycle above which ChainSet switches from committing serially to
+// dispatching commits across the worker pool. n <= 0 is ignored.
+func WithParallelThreshold(n int) ChainSetOption {
+	return func(cs *ChainSet) {
+		if n > 0 {
+			cs.parallelThreshold = n
+		}
+	}
 }
 
 // NewChainSet returns a new ChainSet for managing chains during runtime.
-func NewChainSet(flushType int, flushDuration time.Duration) *ChainSet {
-	return &ChainSet{
-		FlushDuration: flushDuration,
-		flushType:     flushType,
-		Cmap:          make(map[string]*Chain),
-		cancel:        make(chan interface{}),
+func NewChainSet(flushType int, flushDuration time.Duration, opts ...ChainSetOption) *ChainSet {
+	cs := &ChainSet{
+		FlushDuration:     flushDuration,
+		flushType:         flushType,
+		Cmap:              make(map[string]*Chain),
+		cancel:            make(chan struct{}),
+		flushConcurrency:  runtime.NumCPU(),
+		parallelThreshold: defaultParallelThreshold,
+		FlushBytes:        defaultFlushBytes,
+		flushCh:           make(chan *Chain, spaceFlushQueueSize),
+		spaceCond:         sync.NewCond(&sync.Mutex{}),
+		Storage:           defaultStorage,
+	}
+	for _, opt := range opts {
+		opt(cs)
+	}
+	return cs
+}
+
+// WithDefaultStorage sets the Storage backend that NewChainFor uses to
+// create new chains. Defaults to one JSON file per chain.
+func WithDefaultStorage(s Storage) ChainSetOption {
+	return func(cs *ChainSet) {
+		cs.Storage = s
+	}
+}
+
+// WithFlushBytes sets the per-chain pending-byte threshold above which
+// FlushAsSpace enqueues a chain for an out-of-cycle commit. n <= 0 is
+// ignored.
+func WithFlushBytes(n int64) ChainSetOption {
+	return func(cs *ChainSet) {
+		if n > 0 {
+			cs.FlushBytes = n
+		}
+	}
+}
+
+// WithMaxMemoryBytes sets the ceiling on total in-memory, pending-flush
+// bytes across all chains that Append/TryAppend enforce. n <= 0 disables
+// the ceiling (the default).
+func WithMaxMemoryBytes(n int64) ChainSetOption {
+	return func(cs *ChainSet) {
+		cs.MaxMemoryBytes = n
 	}
 }
 
-// Append currently not supported.
 // Appends the block into the chain name passed. The new block is added
 // only in the memory. Commit is done by the chain scheduler and only after
-// commit, the changes appear in the secondary storage.
+// commit, the changes appear in the secondary storage. If MaxMemoryBytes is
+// set and the in-memory footprint across all chains has reached it, Append
+// blocks until the background flusher (FlushAsSpace) drains enough memory.
+// Use TryAppend for a variant that never blocks.
 func (cs *ChainSet) Append(name string, block Block) *Chain {
-	cs.Cmap[name].Append(block)
-	return cs.Cmap[name]
+	cs.waitForHeadroom()
+	return cs.appendAndMaybeEnqueue(name, block)
+}
+
+// TryAppend behaves like Append but never blocks: once MaxMemoryBytes is
+// reached it returns ErrBackpressure instead of waiting for the flusher.
+func (cs *ChainSet) TryAppend(name string, block Block) (*Chain, error) {
+	if cs.MaxMemoryBytes > 0 && cs.loadBytesInMemory() >= cs.MaxMemoryBytes {
+		return nil, ErrBackpressure
+	}
+	return cs.appendAndMaybeEnqueue(name, block), nil
+}
+
+func (cs *ChainSet) waitForHeadroom() {
+	if cs.MaxMemoryBytes <= 0 {
+		return
+	}
+	cs.spaceCond.L.Lock()
+	for cs.loadBytesInMemory() >= cs.MaxMemoryBytes {
+		cs.spaceCond.Wait()
+	}
+	cs.spaceCond.L.Unlock()
+}
+
+// appendAndMaybeEnqueue appends block to the named chain and, once that
+// chain's pending bytes cross FlushBytes, enqueues it for the background
+// space-flusher. The enqueue is best-effort: a full queue just means the
+// chain is offered to the queue again on its next Append instead of being
+// flushed immediately.
+func (cs *ChainSet) appendAndMaybeEnqueue(name string, block Block) *Chain {
+	chain := cs.Cmap[name].Append(block)
+	if cs.flushType == FlushAsSpace && chain.PendingBytes() >= cs.FlushBytes {
+		select {
+		case cs.flushCh <- chain:
+		default:
+		}
+	}
+	return chain
 }
 
 // Cancel cancels or stops the execution of chain scheduler.
+//
+// Deprecated: Cancel only signals the scheduler to stop; it gives the
+// caller no way to wait for in-flight commits, forces no final commit, and
+// reports no commit error on the way out. Use Shutdown instead.
 func (cs *ChainSet) Cancel() {
-	cs.cancel <- ""
+	cs.shutdownOnce.Do(func() {
+		close(cs.cancel)
+	})
+}
+
+// Shutdown stops the scheduler, forces a final commit on every chain that
+// still has unflushed blocks, and waits for any in-flight commits to
+// finish before returning. If ctx is cancelled before the scheduler has
+// exited, Shutdown returns ctx.Err() right away and runs no final commit.
+// Otherwise it returns the commit errors of the final commits, joined.
+func (cs *ChainSet) Shutdown(ctx context.Context) error {
+	cs.shutdownOnce.Do(func() {
+		close(cs.cancel)
+	})
+
+	// Wait for the scheduler goroutine to actually exit before forcing
+	// commits below. Otherwise the scheduler can be mid-commit on a chain
+	// at the same moment Shutdown commits it again, and whichever commit
+	// lands second wins - sometimes the scheduler's, with stale data.
+	drained := make(chan struct{})
+	go func() {
+		cs.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	cs.mux.RLock()
+	pending := make([]*Chain, 0, len(cs.Cmap))
+	for _, chain := range cs.Cmap {
+		if chain.containsNewBlocks {
+			pending = append(pending, chain)
+		}
+	}
+	cs.mux.RUnlock()
+
+	var errs []error
+	for _, chain := range pending {
+		if err := chain.commit(); err != nil {
+			errs = append(errs, fmt.Errorf("chain %s: %w", chain.Name, err))
+		}
+	}
+
+	// Storage is not closed here: it may be shared with other ChainSets
+	// (the whole point of WithDefaultStorage pointing several ChainSets at
+	// one kvStorage). Whoever constructed it owns closing it, after every
+	// ChainSet using it has shut down.
+	return joinErrors(errs)
+}
+
+// joinErrors combines zero or more errors into a single error, in the
+// spirit of errors.Join, without requiring a newer Go toolchain than the
+// rest of this module.
+func joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return errors.New(strings.Join(msgs, "; "))
 }
 
 // Get returns the chain corresponding to the passed name. It returns
@@ -259,9 +616,22 @@ func (cs *ChainSet) Get(name string) (*Chain, bool) {
 func (cs *ChainSet) Register(name string, chainAddress *Chain) {
 	cs.mux.Lock()
 	defer cs.mux.Unlock()
+	chainAddress.owner = cs
 	cs.Cmap[name] = chainAddress
 }
 
+// NewChainFor creates, initializes and registers a new Chain named name
+// at path, persisted through the ChainSet's configured Storage backend,
+// and returns it.
+func (cs *ChainSet) NewChainFor(name, path string) (*Chain, error) {
+	chain := NewChain(path, WithStorage(cs.Storage))
+	if _, err := chain.Init(); err != nil {
+		return nil, err
+	}
+	cs.Register(name, chain)
+	return chain, nil
+}
+
 // Run is a chain scheduler that triggers the ChainSet tasks which currently includes
 // flushing those chains that have newer blocks only. This is done
 // keeping in mind the performance of the system, thus being effective
@@ -269,32 +639,113 @@ func (cs *ChainSet) Register(name string, chainAddress *Chain) {
 func (cs *ChainSet) Run() {
 	switch cs.flushType {
 	case FlushAsTime:
+		cs.wg.Add(1)
 		go func() {
+			defer cs.wg.Done()
 			for {
 				select {
 				case <-cs.cancel:
 					return
 				default:
 				}
-				cs.mux.Lock()
+
+				cs.mux.RLock()
+				dirty := make([]*Chain, 0, len(cs.Cmap))
 				for _, chain := range cs.Cmap {
 					if chain.containsNewBlocks {
-						chain.commit()
+						dirty = append(dirty, chain)
 					} else {
 						// TODO: delete inactive chains and add them back to Cmap when active.
 						chain.inActiveIterations++
 					}
 				}
-				cs.mux.Unlock()
+				cs.mux.RUnlock()
+
+				if len(dirty) > cs.parallelThreshold {
+					cs.commitParallel(dirty)
+				} else {
+					for _, chain := range dirty {
+						if err := chain.commit(); err != nil {
+							log.Errorf("error committing chain %s: %v\n", chain.Name, err)
+						}
+					}
+				}
+				// Wake any Append blocked in waitForHeadroom: without this,
+				// MaxMemoryBytes backpressure under FlushAsTime only ever
+				// gets unblocked by flushChain, which never runs outside
+				// FlushAsSpace.
+				cs.spaceCond.Broadcast()
+
 				runtime.GC()
 				time.Sleep(cs.FlushDuration)
 			}
 		}()
 	case FlushAsSpace:
-		// TODO: Support for flushing when the chain content exceeds
-		// the limit of bytes.
+		cs.wg.Add(1)
+		go func() {
+			defer cs.wg.Done()
+			for {
+				select {
+				case <-cs.cancel:
+					return
+				case chain := <-cs.flushCh:
+					cs.flushChain(chain)
+				}
+			}
+		}()
+	}
+}
+
+// flushChain commits a single chain that was enqueued by
+// appendAndMaybeEnqueue because it crossed FlushBytes, and updates the
+// in-memory byte accounting/metrics and wakes any Append blocked on
+// MaxMemoryBytes headroom.
+func (cs *ChainSet) flushChain(chain *Chain) {
+	if err := chain.commit(); err != nil {
+		log.Errorf("error committing chain %s: %v\n", chain.Name, err)
 		return
 	}
+	cs.spaceCond.Broadcast()
+}
+
+// commitParallel dispatches commit() for each of the given chains across a
+// bounded worker pool sized to cs.flushConcurrency. Chains commit
+// independently under their own per-chain lock, so the worker pool only
+// bounds CPU/IO concurrency and does not serialize unrelated chains.
+// Per-chain errors are collected and logged rather than panicking, since a
+// single bad chain should not bring down the whole flush cycle.
+func (cs *ChainSet) commitParallel(chains []*Chain) {
+	workers := cs.flushConcurrency
+	if workers > len(chains) {
+		workers = len(chains)
+	}
+
+	jobs := make(chan *Chain, len(chains))
+	errs := make(chan error, len(chains))
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chain := range jobs {
+				if err := chain.commit(); err != nil {
+					errs <- fmt.Errorf("chain %s: %w", chain.Name, err)
+				}
+			}
+		}()
+	}
+
+	for _, chain := range chains {
+		jobs <- chain
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		log.Errorf("flush error: %v\n", err)
+	}
 }
 
 // BlockStream returns the address of stream (or list)
@@ -306,11 +757,21 @@ func (c *ChainReadOnly) BlockStream() *[]Block {
 // Refresh loads/reloads the chain from the secondary storage
 // which contains the latest samples/blocks.
 func (c *ChainReadOnly) Refresh() *ChainReadOnly {
-	response, err := parse(c.Path)
+	if c.handle == nil {
+		handle, err := c.storage.Open(c.Path)
+		if err != nil {
+			log.Errorf("error reading the chain: %s\n", c.Path)
+			return c
+		}
+		c.handle = handle
+	}
+	blocks, err := c.storage.Load(c.handle)
 	if err != nil {
-		log.Errorf("error reading the chain: %s\n", c.Path)
+		log.Errorf("error decoding the chain: %s: %v\n", c.Path, err)
+		return c
 	}
-	c.Chain = loadFromStorage(response)
+	c.Chain = &blocks
+	c.sorted = isSortedByTime(blocks)
 	return c
 }
 
@@ -330,44 +791,33 @@ func parse(path string) (*string, error) {
 }
 
 // parseToJSON converts the chain into Marshallable JSON.
-func parseToJSON(a []Block) (j []byte) {
-	j, e := json.Marshal(a)
-	if e != nil {
-		panic(e)
-	}
-	return
+func parseToJSON(a []Block) ([]byte, error) {
+	return json.Marshal(a)
 }
 
-func loadFromStorage(raw *string) *[]Block {
+func loadFromStorage(raw *string) (*[]Block, error) {
 	var inst []Block
-	b := []byte(*raw)
-	e := json.Unmarshal(b, &inst)
-	if e != nil {
-		panic(e)
+	if err := json.Unmarshal([]byte(*raw), &inst); err != nil {
+		return nil, err
 	}
-	return &inst
+	return &inst, nil
 }
 
-func checkAndCreatePath(path string) {
+func checkAndCreatePath(path string) error {
 	array := strings.Split(path, "/")
 	array = array[:len(array)-1]
 	path = strings.Join(array, "/")
-	_, err := os.Stat(path)
-	if err != nil {
-		e := os.MkdirAll(path, os.ModePerm)
-		if e != nil {
-			panic(e)
-		}
+	if _, err := os.Stat(path); err != nil {
+		return os.MkdirAll(path, os.ModePerm)
 	}
+	return nil
 }
 
 func saveToHDD(path string, data []byte) error {
-	checkAndCreatePath(path)
-	e := ioutil.WriteFile(path, data, 0755)
-	if e != nil {
-		return e
+	if err := checkAndCreatePath(path); err != nil {
+		return err
 	}
-	return nil
+	return ioutil.WriteFile(path, data, 0755)
 }
 
 // GetTimeStampCalc returns the timestamp
@@ -0,0 +1,231 @@
+package tsdb
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// slowStorage is a Storage whose Append sleeps for delay, used to give
+// commitParallel's worker pool something to actually parallelize without
+// depending on real disk timing.
+type slowStorage struct {
+	delay time.Duration
+}
+
+func (s *slowStorage) Open(name string) (Handle, error) { return jsonHandle(name), nil }
+
+func (s *slowStorage) Append(handle Handle, blocks []Block) error {
+	time.Sleep(s.delay)
+	return nil
+}
+
+func (s *slowStorage) Load(handle Handle) ([]Block, error) { return nil, nil }
+
+func (s *slowStorage) Iterate(handle Handle, start, end int64) (Iterator, error) {
+	return newSliceIterator(nil, nil), nil
+}
+
+func (s *slowStorage) Close() error { return nil }
+
+// TestChainSetCommitParallel_Correctness flushes 500+ chains through
+// commitParallel and checks that every chain's appended blocks actually
+// made it to disk, intact, with no interleaving between chains.
+func TestChainSetCommitParallel_Correctness(t *testing.T) {
+	const chainCount = 500
+
+	dir, err := ioutil.TempDir("", "tsdb-chunk0-1-correctness")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cs := NewChainSet(FlushAsTime, time.Hour, WithFlushConcurrency(runtime.NumCPU()))
+	chains := make([]*Chain, chainCount)
+	for i := 0; i < chainCount; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("chain-%d.json", i))
+		c := NewChain(path)
+		if _, err := c.Init(); err != nil {
+			t.Fatalf("init chain %d: %v", i, err)
+		}
+		c.Append(*GetNewBlock("test", fmt.Sprintf("value-%d", i)))
+		cs.Register(c.Name, c)
+		chains[i] = c
+	}
+
+	cs.commitParallel(chains)
+
+	for i, c := range chains {
+		if c.containsNewBlocks {
+			t.Errorf("chain %d: still marked dirty after commit", i)
+		}
+		ro := ReadOnly(c.Path).Refresh()
+		blocks := *ro.BlockStream()
+		if len(blocks) != 1 {
+			t.Fatalf("chain %d: expected 1 committed block, got %d", i, len(blocks))
+		}
+		want := fmt.Sprintf("value-%d", i)
+		if blocks[0].Datapoint != want {
+			t.Errorf("chain %d: got datapoint %q, want %q", i, blocks[0].Datapoint, want)
+		}
+	}
+}
+
+// TestChainSetCommitParallel_Speedup asserts that dispatching commits
+// across a worker pool is actually faster than running them one at a
+// time, using an artificial per-commit delay so the result doesn't
+// depend on how fast the test machine's disk happens to be.
+func TestChainSetCommitParallel_Speedup(t *testing.T) {
+	const chainCount = 500
+	const delay = 2 * time.Millisecond
+
+	makeChains := func() []*Chain {
+		chains := make([]*Chain, chainCount)
+		for i := range chains {
+			chains[i] = NewChain(fmt.Sprintf("speedup-chain-%d", i), WithStorage(&slowStorage{delay: delay}))
+			chains[i].Append(*GetNewBlock("test", "v"))
+		}
+		return chains
+	}
+
+	serial := NewChainSet(FlushAsTime, time.Hour, WithFlushConcurrency(1))
+	serialChains := makeChains()
+	start := time.Now()
+	serial.commitParallel(serialChains)
+	serialElapsed := time.Since(start)
+
+	parallel := NewChainSet(FlushAsTime, time.Hour, WithFlushConcurrency(runtime.NumCPU()))
+	parallelChains := makeChains()
+	start = time.Now()
+	parallel.commitParallel(parallelChains)
+	parallelElapsed := time.Since(start)
+
+	if runtime.NumCPU() > 1 && parallelElapsed >= serialElapsed {
+		t.Fatalf("expected parallel commit (%v) to be faster than serial (%v)", parallelElapsed, serialElapsed)
+	}
+}
+
+// TestChainSetAppend_Backpressure asserts that Append blocks once
+// MaxMemoryBytes is reached, and unblocks once a commit drains enough
+// in-memory bytes for the flusher to broadcast headroom.
+func TestChainSetAppend_Backpressure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsdb-chunk0-3-backpressure")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cs := NewChainSet(FlushAsSpace, time.Hour, WithMaxMemoryBytes(1))
+	chain, err := cs.NewChainFor("chain", filepath.Join(dir, "chain.json"))
+	if err != nil {
+		t.Fatalf("NewChainFor: %v", err)
+	}
+
+	cs.Append("chain", *GetNewBlock("test", "first"))
+	if cs.loadBytesInMemory() < cs.MaxMemoryBytes {
+		t.Fatalf("test setup: first append did not cross MaxMemoryBytes")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		cs.Append("chain", *GetNewBlock("test", "second"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatalf("Append returned before the flusher drained any memory")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := chain.commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	cs.spaceCond.Broadcast()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Append stayed blocked after the flusher drained memory below MaxMemoryBytes")
+	}
+}
+
+// TestChainSetShutdown_FlushesPendingChains checks that Shutdown forces a
+// final commit on a chain that still has unflushed blocks, rather than
+// leaving them stranded in memory, even while the time-based scheduler is
+// running concurrently.
+func TestChainSetShutdown_FlushesPendingChains(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsdb-chunk0-5-shutdown")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cs := NewChainSet(FlushAsTime, time.Hour)
+	chain, err := cs.NewChainFor("chain", filepath.Join(dir, "chain.json"))
+	if err != nil {
+		t.Fatalf("NewChainFor: %v", err)
+	}
+	cs.Run()
+
+	chain.Append(*GetNewBlock("test", "pending"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := cs.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if chain.containsNewBlocks {
+		t.Fatalf("chain still marked dirty after Shutdown")
+	}
+	blocks := *ReadOnly(chain.Path).Refresh().BlockStream()
+	if len(blocks) != 1 || blocks[0].Datapoint != "pending" {
+		t.Fatalf("got %v, want one committed block with datapoint %q", blocks, "pending")
+	}
+}
+
+// countingCloseStorage wraps a Storage to record whether Close was called,
+// so a test can assert a ChainSet never closes a Storage it does not own.
+type countingCloseStorage struct {
+	Storage
+	closed bool
+}
+
+func (s *countingCloseStorage) Close() error {
+	s.closed = true
+	return s.Storage.Close()
+}
+
+// TestChainSetShutdown_DoesNotCloseSharedStorage checks that Shutdown
+// leaves its Storage open, since the same Storage can be shared by other
+// ChainSets that haven't shut down yet.
+func TestChainSetShutdown_DoesNotCloseSharedStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsdb-chunk0-5-shutdown-shared-storage")
+	if err != nil {
+		t.Fatalf("tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	storage := &countingCloseStorage{Storage: NewJSONStorage()}
+	cs := NewChainSet(FlushAsTime, time.Hour, WithDefaultStorage(storage))
+	if _, err := cs.NewChainFor("chain", filepath.Join(dir, "chain.json")); err != nil {
+		t.Fatalf("NewChainFor: %v", err)
+	}
+	cs.Run()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := cs.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if storage.closed {
+		t.Fatalf("Shutdown closed a Storage it does not own")
+	}
+}
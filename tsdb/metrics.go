@@ -0,0 +1,56 @@
+package tsdb
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// bytesInMemory reports the current number of encoded bytes held in
+	// memory across all chains, pending their next flush.
+	bytesInMemory = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "bench_routes_tsdb_bytes_in_memory",
+		Help: "Current number of in-memory, not-yet-flushed bytes across all tsdb chains.",
+	})
+	// flushesTotal counts every successful chain commit.
+	flushesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "bench_routes_tsdb_flushes_total",
+		Help: "Total number of tsdb chain flushes (commits) performed.",
+	})
+	// flushDuration tracks how long a single chain commit takes.
+	flushDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "bench_routes_tsdb_flush_duration_seconds",
+		Help: "Time taken to flush (commit) a single tsdb chain to secondary storage.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(bytesInMemory, flushesTotal, flushDuration)
+}
+
+// bytesInMemoryCounter backs the process-wide bytesInMemory gauge. It's a
+// diagnostic total only; MaxMemoryBytes backpressure is decided
+// per-ChainSet (see ChainSet.addBytesInMemory).
+var bytesInMemoryCounter int64
+
+// addBytesInMemory adjusts the in-memory byte accounting by delta, which
+// may be negative, and republishes the bytesInMemory gauge.
+func addBytesInMemory(delta int64) {
+	atomic.AddInt64(&bytesInMemoryCounter, delta)
+	bytesInMemory.Set(float64(atomic.LoadInt64(&bytesInMemoryCounter)))
+}
+
+// loadBytesInMemory returns the current approximate total of unflushed
+// bytes across all chains.
+func loadBytesInMemory() int64 {
+	return atomic.LoadInt64(&bytesInMemoryCounter)
+}
+
+// recordFlush records a completed flush in the flushesTotal/flushDuration
+// metrics.
+func recordFlush(d time.Duration) {
+	flushesTotal.Inc()
+	flushDuration.Observe(d.Seconds())
+}
@@ -0,0 +1,169 @@
+package tsdb
+
+import (
+	"sort"
+
+	"github.com/prometheus/common/log"
+)
+
+// BlockIterator streams Blocks matching a query without materializing the
+// whole result set into memory. Callers should loop on Next until it
+// returns false, then check Err.
+type BlockIterator interface {
+	// Next advances the iterator to the next matching Block. It returns
+	// false once iteration is exhausted or an error occurred.
+	Next() bool
+	// Block returns the Block at the iterator's current position. Only
+	// valid after a call to Next that returned true.
+	Block() Block
+	// Err returns the first error encountered while iterating, if any.
+	Err() error
+	// Close releases any resources held by the iterator.
+	Close() error
+}
+
+// blockFilter reports whether a Block should be included in a query's
+// results.
+type blockFilter func(Block) bool
+
+// sliceIterator is a BlockIterator over an in-memory slice of candidate
+// blocks that have already been narrowed down (by binary search or a
+// linear scan) to a range worth filtering.
+type sliceIterator struct {
+	blocks []Block
+	filter blockFilter
+	idx    int
+}
+
+func newSliceIterator(blocks []Block, filter blockFilter) *sliceIterator {
+	return &sliceIterator{blocks: blocks, filter: filter, idx: -1}
+}
+
+func (it *sliceIterator) Next() bool {
+	for {
+		it.idx++
+		if it.idx >= len(it.blocks) {
+			return false
+		}
+		if it.filter == nil || it.filter(it.blocks[it.idx]) {
+			return true
+		}
+	}
+}
+
+func (it *sliceIterator) Block() Block {
+	return it.blocks[it.idx]
+}
+
+func (it *sliceIterator) Err() error {
+	return nil
+}
+
+func (it *sliceIterator) Close() error {
+	return nil
+}
+
+// filteredIterator narrows another BlockIterator to the blocks matching
+// an additional filter, e.g. layering a type check on top of a
+// Storage.Iterate range scan.
+type filteredIterator struct {
+	BlockIterator
+	filter blockFilter
+}
+
+func (it *filteredIterator) Next() bool {
+	for it.BlockIterator.Next() {
+		if it.filter(it.BlockIterator.Block()) {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryRange returns an iterator over every block whose NormalizedTime
+// falls within [start, end]. When the chain is backed by a Storage with a
+// seekable index (kvStorage), this seeks directly into it via
+// Storage.Iterate instead of scanning the in-memory copy. Otherwise it
+// binary-searches the already-loaded chain, if Refresh found it sorted by
+// NormalizedTime, or falls back to a linear scan.
+func (c *ChainReadOnly) QueryRange(start, end int64) BlockIterator {
+	if _, seekable := c.storage.(*kvStorage); seekable && c.handle != nil {
+		if it, err := c.storage.Iterate(c.handle, start, end); err != nil {
+			log.Errorf("error iterating chain %s, falling back to in-memory scan: %v\n", c.Path, err)
+		} else {
+			return it
+		}
+	}
+	return newSliceIterator(c.rangeSlice(start, end), rangeFilter(start, end))
+}
+
+// QueryByType returns an iterator over every block of type t. Block type
+// is not ordered within a chain, so this is always a linear scan.
+func (c *ChainReadOnly) QueryByType(t string) BlockIterator {
+	return newSliceIterator(*c.Chain, typeFilter(t))
+}
+
+// QueryRangeByType returns an iterator over every block of type t whose
+// NormalizedTime falls within [start, end], applying the same
+// Storage.Iterate/binary-search optimizations as QueryRange.
+func (c *ChainReadOnly) QueryRangeByType(start, end int64, t string) BlockIterator {
+	if _, seekable := c.storage.(*kvStorage); seekable && c.handle != nil {
+		if it, err := c.storage.Iterate(c.handle, start, end); err != nil {
+			log.Errorf("error iterating chain %s, falling back to in-memory scan: %v\n", c.Path, err)
+		} else {
+			return &filteredIterator{BlockIterator: it, filter: typeFilter(t)}
+		}
+	}
+	return newSliceIterator(c.rangeSlice(start, end), andFilter(rangeFilter(start, end), typeFilter(t)))
+}
+
+// rangeSlice narrows the already-loaded chain to the contiguous sub-slice
+// that can contain NormalizedTime in [start, end], via binary search on
+// both ends when c.sorted, or the full slice otherwise.
+func (c *ChainReadOnly) rangeSlice(start, end int64) []Block {
+	blocks := *c.Chain
+	if !c.sorted {
+		return blocks
+	}
+	from := sort.Search(len(blocks), func(i int) bool {
+		return blocks[i].NormalizedTime >= start
+	})
+	to := from + sort.Search(len(blocks)-from, func(i int) bool {
+		return blocks[from+i].NormalizedTime > end
+	})
+	return blocks[from:to]
+}
+
+// isSortedByTime reports whether blocks is non-decreasing in
+// NormalizedTime, which is what makes a binary-searched range scan valid.
+func isSortedByTime(blocks []Block) bool {
+	for i := 1; i < len(blocks); i++ {
+		if blocks[i].NormalizedTime < blocks[i-1].NormalizedTime {
+			return false
+		}
+	}
+	return true
+}
+
+func rangeFilter(start, end int64) blockFilter {
+	return func(b Block) bool {
+		return b.NormalizedTime >= start && b.NormalizedTime <= end
+	}
+}
+
+func typeFilter(t string) blockFilter {
+	return func(b Block) bool {
+		return b.Type == t
+	}
+}
+
+func andFilter(filters ...blockFilter) blockFilter {
+	return func(b Block) bool {
+		for _, f := range filters {
+			if !f(b) {
+				return false
+			}
+		}
+		return true
+	}
+}
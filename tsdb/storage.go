@@ -0,0 +1,34 @@
+package tsdb
+
+// Handle is an opaque reference to a chain's location within a Storage
+// implementation. Callers should treat it as a black box and only pass it
+// back to the Storage that produced it.
+type Handle interface{}
+
+// Iterator streams blocks from a Storage.Iterate call. It has the same
+// shape as BlockIterator so that query.go's helpers can be reused across
+// both in-memory queries and Storage-backed ones.
+type Iterator = BlockIterator
+
+// Storage abstracts how a Chain's blocks are persisted to secondary
+// storage. This lets ChainSet/Chain stay agnostic of whether blocks end
+// up in one JSON file per chain (jsonFileStorage, the original and
+// default behaviour) or in a shared embedded KV database (kvStorage).
+type Storage interface {
+	// Open returns a Handle for the chain named name, creating it if it
+	// does not already exist.
+	Open(name string) (Handle, error)
+	// Append durably appends blocks to the chain behind handle.
+	Append(handle Handle, blocks []Block) error
+	// Load returns every block stored for handle, in storage order.
+	Load(handle Handle) ([]Block, error)
+	// Iterate returns an Iterator over the blocks stored for handle whose
+	// NormalizedTime falls within [start, end].
+	Iterate(handle Handle, start, end int64) (Iterator, error)
+	// Close releases any resources held by the Storage implementation.
+	Close() error
+}
+
+// defaultStorage is used by NewChain/NewChainSet when no Storage option
+// is supplied, preserving the original one-JSON-file-per-chain behaviour.
+var defaultStorage Storage = NewJSONStorage()
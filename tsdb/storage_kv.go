@@ -0,0 +1,201 @@
+package tsdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// kvStorage is a Storage backend that keeps every chain's blocks in a
+// single embedded LSM-tree database (Badger) instead of one file per
+// chain, so range queries become an O(log n) seek instead of the
+// full-file rewrite jsonFileStorage needs on every Append.
+type kvStorage struct {
+	db *badger.DB
+
+	// seq disambiguates blocks that share a NormalizedTime, incremented
+	// once per block written via Append. It is unique only for the life of
+	// this kvStorage value and not persisted, so reopening the database
+	// (e.g. after a restart) resets it to 0; that only matters if a
+	// future Append lands on the exact same NormalizedTime and the exact
+	// same post-restart sequence number as a block from the previous run,
+	// which is far narrower than the content-hash collision it replaces.
+	seq uint32
+}
+
+// KVStorageOption customizes a kvStorage at construction time.
+type KVStorageOption func(*badger.Options)
+
+// WithMemTableSize sets the size, in bytes, of each MemTable before
+// Badger flushes it to an SSTable. Larger values trade memory for fewer,
+// larger flushes.
+func WithMemTableSize(bytes int64) KVStorageOption {
+	return func(opts *badger.Options) {
+		*opts = opts.WithMemTableSize(bytes)
+	}
+}
+
+// NewKVStorage opens (creating if necessary) an embedded Badger database
+// at dir and returns a Storage backed by it.
+func NewKVStorage(dir string, opts ...KVStorageOption) (Storage, error) {
+	options := badger.DefaultOptions(dir)
+	for _, opt := range opts {
+		opt(&options)
+	}
+	db, err := badger.Open(options)
+	if err != nil {
+		return nil, fmt.Errorf("tsdb: opening kv storage at %s: %w", dir, err)
+	}
+	return &kvStorage{db: db}, nil
+}
+
+// kvHandle is the Handle a kvStorage hands back from Open: the chain's
+// key prefix within the shared database.
+type kvHandle string
+
+// Open returns name as the chain's key prefix. Unlike jsonFileStorage,
+// there is nothing to create eagerly: keys come into existence on the
+// first Append.
+func (s *kvStorage) Open(name string) (Handle, error) {
+	return kvHandle(name), nil
+}
+
+// blockKey builds the key a Block is stored under within prefix:
+// prefix/<normalizedTime, zero-padded>/<disambiguator, zero-padded>, so
+// keys for a chain sort in NormalizedTime order. disambiguator must be
+// unique per block, not just per distinct content, or two blocks sharing
+// a NormalizedTime across separate Append calls could overwrite one
+// another — including two byte-identical blocks, which a content hash
+// would alias to the same key.
+func blockKey(prefix string, t int64, disambiguator uint32) []byte {
+	return []byte(fmt.Sprintf("%s/%020d/%010d", prefix, t, disambiguator))
+}
+
+// Append writes blocks to the database under handle's prefix in a single
+// transaction, keying each block by its NormalizedTime and a sequence
+// number from s.seq so that distinct blocks sharing a NormalizedTime
+// across separate Append calls don't collide on the same key, even when
+// the blocks are byte-identical (a content hash can't disambiguate two
+// genuinely-identical blocks, e.g. duplicate health-check samples).
+func (s *kvStorage) Append(handle Handle, blocks []Block) error {
+	prefix, err := kvPrefix(handle)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		for _, b := range blocks {
+			encoded, err := b.Encode()
+			if err != nil {
+				return err
+			}
+			key := blockKey(prefix, b.NormalizedTime, atomic.AddUint32(&s.seq, 1))
+			if err := txn.Set(key, []byte(encoded)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Load returns every block stored under handle's prefix, in key (and
+// therefore NormalizedTime) order.
+func (s *kvStorage) Load(handle Handle) ([]Block, error) {
+	prefix, err := kvPrefix(handle)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []Block
+	err = s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		search := []byte(prefix + "/")
+		for it.Seek(search); it.ValidForPrefix(search); it.Next() {
+			item := it.Item()
+			if err := item.Value(func(val []byte) error {
+				var b Block
+				if err := json.Unmarshal(val, &b); err != nil {
+					return err
+				}
+				blocks = append(blocks, b)
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return blocks, err
+}
+
+// Iterate seeks directly to the start of [start, end] within handle's
+// prefix and streams matching blocks, rather than loading the whole
+// chain the way jsonFileStorage.Iterate must.
+func (s *kvStorage) Iterate(handle Handle, start, end int64) (Iterator, error) {
+	prefix, err := kvPrefix(handle)
+	if err != nil {
+		return nil, err
+	}
+	txn := s.db.NewTransaction(false)
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	it.Seek(blockKey(prefix, start, 0))
+	return &kvIterator{it: it, txn: txn, prefix: []byte(prefix + "/"), end: end}, nil
+}
+
+// Close shuts down the underlying Badger database.
+func (s *kvStorage) Close() error {
+	return s.db.Close()
+}
+
+func kvPrefix(handle Handle) (string, error) {
+	prefix, ok := handle.(kvHandle)
+	if !ok {
+		return "", fmt.Errorf("tsdb: handle %v was not opened by kvStorage", handle)
+	}
+	return string(prefix), nil
+}
+
+// kvIterator adapts a Badger iterator, already seeked to the start of a
+// range, to Iterator. It stops once the key leaves the chain's prefix or
+// a block's NormalizedTime exceeds end.
+type kvIterator struct {
+	it     *badger.Iterator
+	txn    *badger.Txn
+	prefix []byte
+	end    int64
+	block  Block
+	err    error
+}
+
+func (k *kvIterator) Next() bool {
+	if k.err != nil || !k.it.ValidForPrefix(k.prefix) {
+		return false
+	}
+	err := k.it.Item().Value(func(val []byte) error {
+		return json.Unmarshal(val, &k.block)
+	})
+	k.it.Next()
+	if err != nil {
+		k.err = err
+		return false
+	}
+	if k.block.NormalizedTime > k.end {
+		return false
+	}
+	return true
+}
+
+func (k *kvIterator) Block() Block {
+	return k.block
+}
+
+func (k *kvIterator) Err() error {
+	return k.err
+}
+
+func (k *kvIterator) Close() error {
+	k.it.Close()
+	k.txn.Discard()
+	return nil
+}
@@ -0,0 +1,281 @@
+package tsdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// ChainFormat selects how a Chain's blocks are persisted to secondary
+// storage.
+type ChainFormat int
+
+const (
+	// FormatJSON persists the chain as a single JSON array file, rewritten
+	// in full on every commit. This is the original, default format.
+	FormatJSON ChainFormat = iota
+	// FormatBinary persists new blocks as length-prefixed binary records
+	// appended to a write-ahead log, periodically compacted into a
+	// binary snapshot file.
+	FormatBinary
+)
+
+const (
+	// WALExtension is the file extension used for the append-only WAL file.
+	WALExtension = ".wal"
+	// SnapshotExtension is the file extension used for compacted binary
+	// snapshot files.
+	SnapshotExtension = ".tsdb"
+)
+
+// maxWALRecordPayload bounds the payload length decoded off disk before it
+// is used to size an allocation. A length past this is never a real record
+// (no Block encodes anywhere near this large) and is almost always a
+// corrupt or torn varint read off a partially-written length prefix; it
+// must be treated as errTornWALRecord rather than handed to make([]byte,
+// length), which an attacker- or corruption-controlled length can use to
+// OOM-kill the process before the checksum even gets a chance to reject it.
+const maxWALRecordPayload = 64 << 20 // 64MiB
+
+// errTornWALRecord indicates that the final record of a WAL could not be
+// fully read, which is expected when a process crashes mid-write. It is
+// not surfaced to callers of LoadWithWAL; the truncated record is simply
+// discarded.
+var errTornWALRecord = errors.New("tsdb: torn WAL record")
+
+// encodeWALRecord encodes b as a single binary record:
+//
+//	varint(payload length) | payload | crc32(payload)
+//
+// where payload is:
+//
+//	int64 NormalizedTime (8 bytes, big-endian) | byte(len(Type)) | Type |
+//	byte(len(Timestamp)) | Timestamp | Datapoint
+func encodeWALRecord(b Block) []byte {
+	payload := make([]byte, 8+1+len(b.Type)+1+len(b.Timestamp)+len(b.Datapoint))
+	binary.BigEndian.PutUint64(payload[0:8], uint64(b.NormalizedTime))
+	off := 8
+	payload[off] = byte(len(b.Type))
+	off++
+	copy(payload[off:off+len(b.Type)], b.Type)
+	off += len(b.Type)
+	payload[off] = byte(len(b.Timestamp))
+	off++
+	copy(payload[off:off+len(b.Timestamp)], b.Timestamp)
+	off += len(b.Timestamp)
+	copy(payload[off:], b.Datapoint)
+
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(lenBuf, uint64(len(payload)))
+
+	record := make([]byte, 0, n+len(payload)+4)
+	record = append(record, lenBuf[:n]...)
+	record = append(record, payload...)
+	checksum := crc32.ChecksumIEEE(payload)
+	crcBuf := make([]byte, 4)
+	binary.BigEndian.PutUint32(crcBuf, checksum)
+	record = append(record, crcBuf...)
+	return record
+}
+
+// decodeWALRecord reads a single record from r. It returns io.EOF if r is
+// exhausted on a record boundary, and errTornWALRecord if the record is
+// incomplete or malformed, which callers should treat as "stop reading, the
+// rest of the file is a torn write" rather than a fatal error.
+func decodeWALRecord(r *bufio.Reader) (Block, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		// A clean io.EOF means r is positioned exactly on a record
+		// boundary, i.e. there is no more data at all; propagate it
+		// as-is so readRecords can tell "nothing left to read" apart
+		// from "the last record was torn". Anything else reading the
+		// length varint - a truncated io.ErrUnexpectedEOF, or garbage
+		// bytes ReadUvarint rejects as overflowing a uint64 - is a
+		// torn-write scenario here, not a fatal error.
+		if errors.Is(err, io.EOF) {
+			return Block{}, err
+		}
+		return Block{}, errTornWALRecord
+	}
+
+	if length > maxWALRecordPayload {
+		return Block{}, errTornWALRecord
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Block{}, errTornWALRecord
+	}
+
+	crcBuf := make([]byte, 4)
+	if _, err := io.ReadFull(r, crcBuf); err != nil {
+		return Block{}, errTornWALRecord
+	}
+	if binary.BigEndian.Uint32(crcBuf) != crc32.ChecksumIEEE(payload) {
+		return Block{}, errTornWALRecord
+	}
+
+	if len(payload) < 9 {
+		return Block{}, errTornWALRecord
+	}
+	normalizedTime := int64(binary.BigEndian.Uint64(payload[0:8]))
+	off := 8
+	typeLen := int(payload[off])
+	off++
+	if len(payload) < off+typeLen+1 {
+		return Block{}, errTornWALRecord
+	}
+	blockType := string(payload[off : off+typeLen])
+	off += typeLen
+	timestampLen := int(payload[off])
+	off++
+	if len(payload) < off+timestampLen {
+		return Block{}, errTornWALRecord
+	}
+	timestamp := string(payload[off : off+timestampLen])
+	off += timestampLen
+	datapoint := string(payload[off:])
+
+	return Block{
+		NormalizedTime: normalizedTime,
+		Type:           blockType,
+		Timestamp:      timestamp,
+		Datapoint:      datapoint,
+	}, nil
+}
+
+// AppendWAL appends b to the chain's WAL file as a single binary record,
+// without touching the snapshot file. It is the FormatBinary counterpart
+// to Append, used when the caller wants the block durable before the next
+// Compact runs.
+func (c *Chain) AppendWAL(b Block) error {
+	if err := checkAndCreatePath(c.walPath()); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(c.walPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(encodeWALRecord(b)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Compact reads the chain's existing binary snapshot plus its WAL, merges
+// them, and rewrites the snapshot file. On success the WAL is truncated so
+// that replaying it again is a no-op.
+func (c *Chain) Compact() error {
+	blocks, err := readSnapshot(c.snapshotPath())
+	if err != nil {
+		return err
+	}
+	walBlocks, _, err := readWAL(c.walPath())
+	if err != nil {
+		return err
+	}
+	blocks = append(blocks, walBlocks...)
+
+	if err := writeSnapshot(c.snapshotPath(), blocks); err != nil {
+		return err
+	}
+	return os.Truncate(c.walPath(), 0)
+}
+
+// LoadWithWAL loads the binary snapshot at path+SnapshotExtension, replays
+// path+WALExtension on top of it, and returns the resulting in-memory
+// Chain. A truncated final WAL record (the hallmark of a crash mid-append)
+// is discarded rather than treated as an error.
+func LoadWithWAL(path string) (*Chain, error) {
+	blocks, err := readSnapshot(path + SnapshotExtension)
+	if err != nil {
+		return nil, err
+	}
+	walBlocks, torn, err := readWAL(path + WALExtension)
+	if err != nil {
+		return nil, err
+	}
+	blocks = append(blocks, walBlocks...)
+
+	return &Chain{
+		Name:              filterChainPath(path),
+		Path:              path,
+		Format:            FormatBinary,
+		Chain:             blocks,
+		LengthElements:    len(blocks),
+		containsNewBlocks: len(walBlocks) > 0 || torn,
+	}, nil
+}
+
+// readSnapshot reads and decodes every record in a compacted snapshot file.
+// A missing file is treated as an empty chain, matching Chain.Init's
+// behaviour for the JSON format.
+func readSnapshot(path string) ([]Block, error) {
+	blocks, _, err := readRecords(path)
+	if os.IsNotExist(err) {
+		return []Block{}, nil
+	}
+	return blocks, err
+}
+
+// readWAL reads and decodes every record in a WAL file, stopping at (and
+// discarding) a torn final record. It reports whether a torn record was
+// found so callers can mark the chain as not-yet-durable.
+func readWAL(path string) (blocks []Block, torn bool, err error) {
+	blocks, torn, err = readRecords(path)
+	if os.IsNotExist(err) {
+		return []Block{}, false, nil
+	}
+	return blocks, torn, err
+}
+
+// readRecords decodes every record in the file at path in order, stopping
+// at the first torn or checksum-mismatched record instead of failing.
+func readRecords(path string) (blocks []Block, torn bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		b, err := decodeWALRecord(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return blocks, false, nil
+			}
+			if errors.Is(err, errTornWALRecord) {
+				return blocks, true, nil
+			}
+			// Not expected given decodeWALRecord's contract above (every
+			// error it returns is io.EOF or errTornWALRecord), but don't
+			// discard already-decoded, valid blocks if that ever changes.
+			return blocks, false, err
+		}
+		blocks = append(blocks, b)
+	}
+}
+
+// writeSnapshot rewrites the snapshot file at path from scratch, encoding
+// every block as a WAL-style record.
+func writeSnapshot(path string, blocks []Block) error {
+	buf := make([]byte, 0, len(blocks)*32)
+	for _, b := range blocks {
+		buf = append(buf, encodeWALRecord(b)...)
+	}
+	return saveToHDD(path, buf)
+}
+
+func (c *Chain) walPath() string {
+	return c.Path + WALExtension
+}
+
+func (c *Chain) snapshotPath() string {
+	return c.Path + SnapshotExtension
+}